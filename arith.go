@@ -0,0 +1,233 @@
+// Copyright (c) 2016, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package sh
+
+import (
+	"fmt"
+
+	"github.com/improbable-io/sh/ast"
+	"github.com/improbable-io/sh/token"
+)
+
+// arithTokKind identifies the kind of a single arithmetic token.
+type arithTokKind int
+
+const (
+	atEOF arithTokKind = iota
+	atNum
+	atIdent
+	atOp
+	atLParen
+	atRParen
+)
+
+// arithTok is a single arithmetic token, with its offset within the
+// arithmetic expression's source text.
+type arithTok struct {
+	kind arithTokKind
+	val  string
+	off  int
+}
+
+// arithOps lists the two-character arithmetic operators, checked
+// before falling back to a single character.
+var arithOps = []string{
+	"**", "==", "!=", "<=", ">=", "&&", "||", "<<", ">>",
+	"+=", "-=", "*=", "/=", "%=",
+}
+
+func lexArith(src string) []arithTok {
+	var toks []arithTok
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(src) && src[j] >= '0' && src[j] <= '9' {
+				j++
+			}
+			toks = append(toks, arithTok{kind: atNum, val: src[i:j], off: i})
+			i = j
+		case isIdentByte(c) && !(c >= '0' && c <= '9'):
+			j := i
+			for j < len(src) && isIdentByte(src[j]) {
+				j++
+			}
+			toks = append(toks, arithTok{kind: atIdent, val: src[i:j], off: i})
+			i = j
+		case c == '(':
+			toks = append(toks, arithTok{kind: atLParen, val: "(", off: i})
+			i++
+		case c == ')':
+			toks = append(toks, arithTok{kind: atRParen, val: ")", off: i})
+			i++
+		default:
+			op := string(c)
+			if i+1 < len(src) {
+				two := src[i : i+2]
+				for _, o := range arithOps {
+					if o == two {
+						op = two
+						break
+					}
+				}
+			}
+			toks = append(toks, arithTok{kind: atOp, val: op, off: i})
+			i += len(op)
+		}
+	}
+	toks = append(toks, arithTok{kind: atEOF, off: len(src)})
+	return toks
+}
+
+// arithPrecLevels lists binary operators from lowest to highest
+// precedence; '**' and the unary operators are handled separately, as
+// is the ternary '?:' operator, which binds looser than all of these.
+var arithPrecLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", ">", "<=", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+var arithAssignOps = map[string]bool{
+	"=": true, "+=": true, "-=": true, "*=": true, "/=": true, "%=": true,
+}
+
+// arithParser is a small recursive-descent expression parser for the
+// contents of a '$((...))' arithmetic expansion.
+type arithParser struct {
+	fset *token.FileSet
+	f    *token.File
+	base int // offset of the expression's first byte within f
+	toks []arithTok
+	i    int
+	tok  arithTok
+}
+
+// parseArith parses the arithmetic expression src, which started at
+// offset base within f, into its ast.Node tree.
+func parseArith(src string, fset *token.FileSet, f *token.File, base int) ast.Node {
+	p := &arithParser{fset: fset, f: f, base: base, toks: lexArith(src)}
+	p.next()
+	return p.assign()
+}
+
+func (p *arithParser) pos(off int) token.Pos { return p.f.Pos(p.base + off) }
+
+// errorf builds the same *parseError type the rest of the parser
+// uses, so a malformed arithmetic expansion is reported as a normal
+// parse error rather than an uncaught panic.
+func (p *arithParser) errorf(format string, args ...interface{}) error {
+	return &parseError{
+		pos: p.fset.Position(p.pos(p.tok.off)),
+		msg: fmt.Sprintf(format, args...),
+	}
+}
+
+func (p *arithParser) next() {
+	p.tok = p.toks[p.i]
+	if p.i < len(p.toks)-1 {
+		p.i++
+	}
+}
+
+func (p *arithParser) assign() ast.Node {
+	x := p.ternary()
+	if p.tok.kind == atOp && arithAssignOps[p.tok.val] {
+		op, opPos := p.tok.val, p.pos(p.tok.off)
+		p.next()
+		y := p.assign()
+		return ast.ArithBinaryExpr{OpPos: opPos, Op: op, X: x, Y: y}
+	}
+	return x
+}
+
+func (p *arithParser) ternary() ast.Node {
+	cond := p.binary(0)
+	if p.tok.kind == atOp && p.tok.val == "?" {
+		p.next()
+		x := p.assign()
+		if !(p.tok.kind == atOp && p.tok.val == ":") {
+			panic(p.errorf("expected ':' in arithmetic expression"))
+		}
+		p.next()
+		y := p.assign()
+		return ast.ArithCondExpr{Cond: cond, X: x, Y: y}
+	}
+	return cond
+}
+
+func (p *arithParser) binary(level int) ast.Node {
+	if level >= len(arithPrecLevels) {
+		return p.pow()
+	}
+	x := p.binary(level + 1)
+	for p.tok.kind == atOp && inOpSet(p.tok.val, arithPrecLevels[level]) {
+		op, opPos := p.tok.val, p.pos(p.tok.off)
+		p.next()
+		y := p.binary(level + 1)
+		x = ast.ArithBinaryExpr{OpPos: opPos, Op: op, X: x, Y: y}
+	}
+	return x
+}
+
+func (p *arithParser) pow() ast.Node {
+	x := p.unary()
+	if p.tok.kind == atOp && p.tok.val == "**" {
+		opPos := p.pos(p.tok.off)
+		p.next()
+		y := p.pow()
+		return ast.ArithBinaryExpr{OpPos: opPos, Op: "**", X: x, Y: y}
+	}
+	return x
+}
+
+func (p *arithParser) unary() ast.Node {
+	if p.tok.kind == atOp && (p.tok.val == "!" || p.tok.val == "~" || p.tok.val == "-" || p.tok.val == "+") {
+		op, opPos := p.tok.val, p.pos(p.tok.off)
+		p.next()
+		x := p.unary()
+		return ast.ArithUnaryExpr{OpPos: opPos, Op: op, X: x}
+	}
+	return p.primary()
+}
+
+func (p *arithParser) primary() ast.Node {
+	switch p.tok.kind {
+	case atNum, atIdent:
+		n := ast.ArithLit{ValuePos: p.pos(p.tok.off), Value: p.tok.val}
+		p.next()
+		return n
+	case atLParen:
+		lparen := p.pos(p.tok.off)
+		p.next()
+		x := p.assign()
+		if p.tok.kind != atRParen {
+			panic(p.errorf("expected ')' in arithmetic expression"))
+		}
+		rparen := p.pos(p.tok.off)
+		p.next()
+		return ast.ArithParenExpr{Lparen: lparen, Rparen: rparen, X: x}
+	}
+	panic(p.errorf("unexpected token in arithmetic expression"))
+}
+
+func inOpSet(op string, set []string) bool {
+	for _, o := range set {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,537 @@
+// Copyright (c) 2016, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+// Package ast declares the types used to represent syntax trees for
+// shell source files, analogous to go/ast.
+package ast
+
+import (
+	"strings"
+
+	"github.com/improbable-io/sh/token"
+)
+
+// Node is implemented by every node of the AST: statements,
+// expressions and the words they are made of. Pos returns the position
+// of the first byte of the node, and End the position just past its
+// last byte.
+type Node interface {
+	Pos() token.Pos
+	End() token.Pos
+	String() string
+}
+
+func stmtsEnd(stmts []Node) token.Pos {
+	if len(stmts) == 0 {
+		return token.NoPos
+	}
+	return stmts[len(stmts)-1].End()
+}
+
+func stmtsString(stmts []Node) string {
+	strs := make([]string, len(stmts))
+	for i, s := range stmts {
+		strs[i] = s.String()
+	}
+	return strings.Join(strs, "; ")
+}
+
+// File is the root node of a parsed shell source file.
+type File struct {
+	Name  string
+	Stmts []Node
+}
+
+func (f *File) Pos() token.Pos {
+	if len(f.Stmts) == 0 {
+		return token.NoPos
+	}
+	return f.Stmts[0].Pos()
+}
+func (f *File) End() token.Pos { return stmtsEnd(f.Stmts) }
+func (f *File) String() string { return stmtsString(f.Stmts) }
+
+// Comment represents a '#' comment up to the end of the line.
+type Comment struct {
+	Hash token.Pos
+	Text string
+}
+
+func (c Comment) Pos() token.Pos { return c.Hash }
+func (c Comment) End() token.Pos { return c.Hash + token.Pos(1+len(c.Text)) }
+func (c Comment) String() string { return "#" + c.Text }
+
+// Lit is a single unquoted, unexpanded literal word.
+type Lit struct {
+	ValuePos token.Pos
+	Value    string
+}
+
+func (l Lit) Pos() token.Pos { return l.ValuePos }
+func (l Lit) End() token.Pos { return l.ValuePos + token.Pos(len(l.Value)) }
+func (l Lit) String() string { return l.Value }
+
+// Command is a simple command: a list of words, where the first is
+// the name and the rest are arguments and/or redirects.
+type Command struct {
+	Args []Node
+}
+
+func (c Command) Pos() token.Pos {
+	if len(c.Args) == 0 {
+		return token.NoPos
+	}
+	return c.Args[0].Pos()
+}
+func (c Command) End() token.Pos { return stmtsEnd(c.Args) }
+func (c Command) String() string {
+	strs := make([]string, len(c.Args))
+	for i, a := range c.Args {
+		strs[i] = a.String()
+	}
+	return strings.Join(strs, " ")
+}
+
+// Subshell is a '( ... )' group, run in a child shell process.
+type Subshell struct {
+	Lparen, Rparen token.Pos
+	Stmts          []Node
+}
+
+func (s Subshell) Pos() token.Pos { return s.Lparen }
+func (s Subshell) End() token.Pos { return s.Rparen + 1 }
+func (s Subshell) String() string {
+	return "( " + stmtsString(s.Stmts) + "; )"
+}
+
+// Block is a '{ ... }' group, run in the current shell process.
+type Block struct {
+	Lbrace, Rbrace token.Pos
+	Stmts          []Node
+}
+
+func (b Block) Pos() token.Pos { return b.Lbrace }
+func (b Block) End() token.Pos { return b.Rbrace + 1 }
+func (b Block) String() string {
+	return "{ " + stmtsString(b.Stmts) + "; }"
+}
+
+// IfStmt represents an 'if cond; then ...; fi' statement, optionally
+// followed by any number of Elif clauses and an else branch.
+type IfStmt struct {
+	If, Fi    token.Pos
+	Cond      Node
+	Then      token.Pos
+	ThenStmts []Node
+	Elifs     []Node
+	Else      token.Pos
+	ElseStmts []Node
+}
+
+func (s IfStmt) Pos() token.Pos { return s.If }
+func (s IfStmt) End() token.Pos { return s.Fi + 2 }
+func (s IfStmt) String() string {
+	var b strings.Builder
+	b.WriteString("if ")
+	b.WriteString(s.Cond.String())
+	b.WriteString("; then ")
+	b.WriteString(stmtsString(s.ThenStmts))
+	for _, n := range s.Elifs {
+		b.WriteString("; ")
+		b.WriteString(n.String())
+	}
+	if s.ElseStmts != nil {
+		b.WriteString("; else ")
+		b.WriteString(stmtsString(s.ElseStmts))
+	}
+	b.WriteString("; fi")
+	return b.String()
+}
+
+// Elif represents an 'elif cond; then ...' clause within an IfStmt.
+type Elif struct {
+	Elif      token.Pos
+	Cond      Node
+	Then      token.Pos
+	ThenStmts []Node
+}
+
+func (e Elif) Pos() token.Pos { return e.Elif }
+func (e Elif) End() token.Pos { return stmtsEnd(e.ThenStmts) }
+func (e Elif) String() string {
+	return "elif " + e.Cond.String() + "; then " + stmtsString(e.ThenStmts)
+}
+
+// WhileStmt represents a 'while cond; do ...; done' loop.
+type WhileStmt struct {
+	While, Done token.Pos
+	Cond        Node
+	Do          token.Pos
+	DoStmts     []Node
+}
+
+func (s WhileStmt) Pos() token.Pos { return s.While }
+func (s WhileStmt) End() token.Pos { return s.Done + 4 }
+func (s WhileStmt) String() string {
+	return "while " + s.Cond.String() + "; do " + stmtsString(s.DoStmts) + "; done"
+}
+
+// UntilStmt represents an 'until cond; do ...; done' loop.
+type UntilStmt struct {
+	Until, Done token.Pos
+	Cond        Node
+	Do          token.Pos
+	DoStmts     []Node
+}
+
+func (s UntilStmt) Pos() token.Pos { return s.Until }
+func (s UntilStmt) End() token.Pos { return s.Done + 4 }
+func (s UntilStmt) String() string {
+	return "until " + s.Cond.String() + "; do " + stmtsString(s.DoStmts) + "; done"
+}
+
+// ForStmt represents a 'for name in word...; do ...; done' loop, or
+// its shorthand 'for name; do ...; done' form which iterates over
+// "$@".
+type ForStmt struct {
+	For, Done token.Pos
+	Name      Lit
+	In        bool // whether an explicit 'in word...' clause is present
+	WordList  []Node
+	Do        token.Pos
+	DoStmts   []Node
+}
+
+func (s ForStmt) Pos() token.Pos { return s.For }
+func (s ForStmt) End() token.Pos { return s.Done + 4 }
+func (s ForStmt) String() string {
+	var b strings.Builder
+	b.WriteString("for ")
+	b.WriteString(s.Name.String())
+	if s.In {
+		b.WriteString(" in")
+		for _, w := range s.WordList {
+			b.WriteString(" ")
+			b.WriteString(w.String())
+		}
+	}
+	b.WriteString("; do ")
+	b.WriteString(stmtsString(s.DoStmts))
+	b.WriteString("; done")
+	return b.String()
+}
+
+// CaseStmt represents a 'case word in pat) ...;; esac' statement.
+type CaseStmt struct {
+	Case, Esac token.Pos
+	Word       Node
+	In         token.Pos
+	Items      []Node
+}
+
+func (s CaseStmt) Pos() token.Pos { return s.Case }
+func (s CaseStmt) End() token.Pos { return s.Esac + 4 }
+func (s CaseStmt) String() string {
+	var b strings.Builder
+	b.WriteString("case ")
+	b.WriteString(s.Word.String())
+	b.WriteString(" in")
+	for _, it := range s.Items {
+		b.WriteString(" ")
+		b.WriteString(it.String())
+	}
+	b.WriteString(" esac")
+	return b.String()
+}
+
+// PatternClause is a single 'pat1|pat2) stmts;;' clause within a
+// CaseStmt.
+type PatternClause struct {
+	Patterns   []Node
+	Rparen     token.Pos
+	Stmts      []Node
+	DSemi      token.Pos // position of the ';;', if Terminated
+	Terminated bool      // false for the last clause if ';;' was omitted
+}
+
+func (c PatternClause) Pos() token.Pos {
+	if len(c.Patterns) == 0 {
+		return token.NoPos
+	}
+	return c.Patterns[0].Pos()
+}
+func (c PatternClause) End() token.Pos {
+	if c.Terminated {
+		return c.DSemi + 2
+	}
+	if len(c.Stmts) > 0 {
+		return stmtsEnd(c.Stmts)
+	}
+	return c.Rparen + 1
+}
+func (c PatternClause) String() string {
+	strs := make([]string, len(c.Patterns))
+	for i, p := range c.Patterns {
+		strs[i] = p.String()
+	}
+	s := strings.Join(strs, "|") + ") " + stmtsString(c.Stmts)
+	if c.Terminated {
+		s += ";;"
+	}
+	return s
+}
+
+// BinaryExpr represents a binary expression between two statements,
+// such as pipelines ('|') and the '&&'/'||' operators.
+type BinaryExpr struct {
+	OpPos token.Pos
+	Op    string
+	X, Y  Node
+}
+
+func (b BinaryExpr) Pos() token.Pos { return b.X.Pos() }
+func (b BinaryExpr) End() token.Pos { return b.Y.End() }
+func (b BinaryExpr) String() string {
+	return b.X.String() + " " + b.Op + " " + b.Y.String()
+}
+
+// FuncDecl represents a function declaration, 'name() body'.
+type FuncDecl struct {
+	Name           Lit
+	Lparen, Rparen token.Pos
+	Body           Node
+}
+
+func (f FuncDecl) Pos() token.Pos { return f.Name.Pos() }
+func (f FuncDecl) End() token.Pos { return f.Body.End() }
+func (f FuncDecl) String() string {
+	return f.Name.String() + "() " + f.Body.String()
+}
+
+// partsString concatenates the String() of each part with no
+// separator, since the parts of a Word or DqStringPart are adjacent
+// substrings of the same source text.
+func partsString(parts []Node) string {
+	var b strings.Builder
+	for _, p := range parts {
+		b.WriteString(p.String())
+	}
+	return b.String()
+}
+
+// Word is a single shell word, expressed as an ordered slice of parts:
+// literal text, quoted strings, and expansions. A purely literal word
+// has a single LitPart.
+type Word struct {
+	Parts []Node
+}
+
+func (w Word) Pos() token.Pos {
+	if len(w.Parts) == 0 {
+		return token.NoPos
+	}
+	return w.Parts[0].Pos()
+}
+func (w Word) End() token.Pos {
+	if len(w.Parts) == 0 {
+		return token.NoPos
+	}
+	return w.Parts[len(w.Parts)-1].End()
+}
+func (w Word) String() string { return partsString(w.Parts) }
+
+// LitPart is a run of unquoted, unexpanded literal text within a Word.
+type LitPart struct {
+	ValuePos token.Pos
+	Value    string
+}
+
+func (l LitPart) Pos() token.Pos { return l.ValuePos }
+func (l LitPart) End() token.Pos { return l.ValuePos + token.Pos(len(l.Value)) }
+func (l LitPart) String() string { return l.Value }
+
+// SqStringPart is a single-quoted 'literal' part of a Word. Value
+// holds the text between the quotes, unprocessed.
+type SqStringPart struct {
+	Quote token.Pos
+	Value string
+}
+
+func (s SqStringPart) Pos() token.Pos { return s.Quote }
+func (s SqStringPart) End() token.Pos { return s.Quote + token.Pos(2+len(s.Value)) }
+func (s SqStringPart) String() string { return "'" + s.Value + "'" }
+
+// DqStringPart is a double-quoted "..." part of a Word. Its Parts may
+// themselves hold expansions, since '$' and '`' keep their meaning
+// inside double quotes.
+type DqStringPart struct {
+	Quote, Rquote token.Pos
+	Parts         []Node
+}
+
+func (d DqStringPart) Pos() token.Pos { return d.Quote }
+func (d DqStringPart) End() token.Pos { return d.Rquote + 1 }
+func (d DqStringPart) String() string { return "\"" + partsString(d.Parts) + "\"" }
+
+// ParamExp represents a parameter expansion: the bare '$name' form, or
+// the braced '${name op arg}' form such as '${var:-default}' or
+// '${var#pat}'. Op and Arg are zero unless a braced operator is
+// present.
+type ParamExp struct {
+	Dollar token.Pos
+	Braced bool
+	Name   string
+	Op     string // e.g. ":-", "#", "##", "%", "%%"
+	Arg    Node
+	Rbrace token.Pos // only set when Braced
+}
+
+func (p ParamExp) Pos() token.Pos { return p.Dollar }
+func (p ParamExp) End() token.Pos {
+	if p.Braced {
+		return p.Rbrace + 1
+	}
+	return p.Dollar + token.Pos(1+len(p.Name))
+}
+func (p ParamExp) String() string {
+	if !p.Braced {
+		return "$" + p.Name
+	}
+	s := "${" + p.Name + p.Op
+	if p.Arg != nil {
+		s += p.Arg.String()
+	}
+	return s + "}"
+}
+
+// CmdSubst represents a command substitution, either the '$(...)' form
+// or the older backtick '`...`' form.
+type CmdSubst struct {
+	Left, Right token.Pos
+	Backtick    bool
+	Stmts       []Node
+}
+
+func (c CmdSubst) Pos() token.Pos { return c.Left }
+func (c CmdSubst) End() token.Pos { return c.Right + 1 }
+func (c CmdSubst) String() string {
+	if c.Backtick {
+		return "`" + stmtsString(c.Stmts) + "`"
+	}
+	return "$(" + stmtsString(c.Stmts) + ")"
+}
+
+// ArithExpr represents an arithmetic expansion, '$((expr))'.
+type ArithExpr struct {
+	Dollar token.Pos
+	X      Node
+	Rparen token.Pos
+}
+
+func (a ArithExpr) Pos() token.Pos { return a.Dollar }
+func (a ArithExpr) End() token.Pos { return a.Rparen + 1 }
+func (a ArithExpr) String() string { return "$((" + a.X.String() + "))" }
+
+// ArithLit is a number or identifier within an arithmetic expression.
+type ArithLit struct {
+	ValuePos token.Pos
+	Value    string
+}
+
+func (a ArithLit) Pos() token.Pos { return a.ValuePos }
+func (a ArithLit) End() token.Pos { return a.ValuePos + token.Pos(len(a.Value)) }
+func (a ArithLit) String() string { return a.Value }
+
+// ArithUnaryExpr represents a prefix unary arithmetic operator, such
+// as '!', '~', unary '-' or unary '+'.
+type ArithUnaryExpr struct {
+	OpPos token.Pos
+	Op    string
+	X     Node
+}
+
+func (a ArithUnaryExpr) Pos() token.Pos { return a.OpPos }
+func (a ArithUnaryExpr) End() token.Pos { return a.X.End() }
+func (a ArithUnaryExpr) String() string { return a.Op + a.X.String() }
+
+// ArithBinaryExpr represents a binary or assignment arithmetic
+// operator, such as '+', '**', '<<' or '+='.
+type ArithBinaryExpr struct {
+	OpPos token.Pos
+	Op    string
+	X, Y  Node
+}
+
+func (a ArithBinaryExpr) Pos() token.Pos { return a.X.Pos() }
+func (a ArithBinaryExpr) End() token.Pos { return a.Y.End() }
+func (a ArithBinaryExpr) String() string {
+	return a.X.String() + a.Op + a.Y.String()
+}
+
+// ArithCondExpr represents the ternary conditional operator,
+// 'cond ? x : y'.
+type ArithCondExpr struct {
+	Cond, X, Y Node
+}
+
+func (a ArithCondExpr) Pos() token.Pos { return a.Cond.Pos() }
+func (a ArithCondExpr) End() token.Pos { return a.Y.End() }
+func (a ArithCondExpr) String() string {
+	return a.Cond.String() + "?" + a.X.String() + ":" + a.Y.String()
+}
+
+// ArithParenExpr represents a parenthesized arithmetic sub-expression.
+type ArithParenExpr struct {
+	Lparen, Rparen token.Pos
+	X              Node
+}
+
+func (a ArithParenExpr) Pos() token.Pos { return a.Lparen }
+func (a ArithParenExpr) End() token.Pos { return a.Rparen + 1 }
+func (a ArithParenExpr) String() string { return "(" + a.X.String() + ")" }
+
+// Redirect represents an input/output redirection, such as '>', '>>',
+// '<', '<<' (here-document), '<<-' (here-document with leading tabs
+// stripped from the delimiter line) or '<<<' (here-string).
+//
+// Heredoc, Tabs and Quoted are only meaningful when Op is "<<" or
+// "<<-": Heredoc holds the body exactly as it appeared in the source,
+// Tabs reports whether the "<<-" form was used (leading tabs should be
+// stripped from each body line by a consumer that interprets it), and
+// Quoted reports whether the delimiter word was quoted, which disables
+// parameter and command substitution within the body.
+type Redirect struct {
+	OpPos       token.Pos
+	Op          string
+	Obj         Node
+	Heredoc     string
+	CloseIndent string // leading tabs stripped from the closing delimiter line, if any
+	Tabs        bool
+	Quoted      bool
+}
+
+func (r Redirect) Pos() token.Pos { return r.OpPos }
+func (r Redirect) End() token.Pos {
+	if r.Op == "<<" || r.Op == "<<-" {
+		return r.Obj.End() + token.Pos(1+len(r.Heredoc)+len(r.CloseIndent)+len(heredocDelim(r.Obj.String())))
+	}
+	return r.Obj.End()
+}
+func (r Redirect) String() string {
+	if r.Op == "<<" || r.Op == "<<-" {
+		return r.Op + r.Obj.String() + "\n" + r.Heredoc + r.CloseIndent + heredocDelim(r.Obj.String())
+	}
+	return r.Op + r.Obj.String()
+}
+
+// heredocDelim strips a matching pair of surrounding quotes from a
+// heredoc delimiter word, as the closing line in the source only ever
+// contains the bare delimiter text, even if the opening one was quoted.
+func heredocDelim(s string) string {
+	if len(s) >= 2 {
+		if (s[0] == '\'' && s[len(s)-1] == '\'') || (s[0] == '"' && s[len(s)-1] == '"') {
+			return s[1 : len(s)-1]
+		}
+	}
+	return s
+}
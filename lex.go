@@ -0,0 +1,615 @@
+// Copyright (c) 2016, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package sh
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/improbable-io/sh/ast"
+	"github.com/improbable-io/sh/token"
+)
+
+type tokKind int
+
+const (
+	tEOF tokKind = iota
+	tWord
+	tComment
+	tSemicolon // ;
+	tSemiSemi  // ;;
+	tNewline
+	tAndAnd       // &&
+	tAmp          // &
+	tOrOr         // ||
+	tPipe         // |
+	tLParen       // (
+	tRParen       // )
+	tGt           // >
+	tGtGt         // >>
+	tLt           // <
+	tDHeredoc     // <<
+	tDHeredocDash // <<-
+	tHereString   // <<<
+)
+
+// tok is a single lexical token along with the position of its
+// first byte. parts, heredoc, closeIndent, tabs and quoted are only
+// populated for the token kinds that need them: parts for tWord, and
+// heredoc/closeIndent/tabs/quoted for tDHeredoc/tDHeredocDash tokens
+// once their body has been read.
+type tok struct {
+	kind        tokKind
+	val         string
+	pos         token.Pos
+	parts       []ast.Node
+	heredoc     string
+	closeIndent string
+	tabs        bool
+	quoted      bool
+}
+
+// opMeta reports whether r is a shell operator meta-character: one
+// that always ends the current word, even without surrounding
+// whitespace.
+func opMeta(r byte) bool {
+	switch r {
+	case ';', '&', '|', '(', ')', '<', '>':
+		return true
+	}
+	return false
+}
+
+// lexer turns shell source into a flat slice of tokens. fset is used
+// to report error positions and to parse the contents of command
+// substitutions and arithmetic expansions.
+type lexer struct {
+	fset *token.FileSet
+	f    *token.File
+	src  string
+	i    int
+}
+
+// pendingHeredoc records a '<<' or '<<-' token awaiting its body, which
+// is only found once the rest of the logical line has been lexed.
+type pendingHeredoc struct {
+	idx   int // index into toks of the operator token
+	delim string
+	tabs  bool
+}
+
+func lex(fset *token.FileSet, f *token.File, src string) []tok {
+	l := &lexer{fset: fset, f: f, src: src}
+	return l.run()
+}
+
+// run lexes from the lexer's current position to the end of its src,
+// returning the flat token slice. It is also used to lex the inner
+// statements of a command substitution, over a src truncated to end
+// exactly at the substitution's closing delimiter.
+func (l *lexer) run() []tok {
+	var toks []tok
+	var pending []pendingHeredoc
+	for {
+		tk := l.next()
+		toks = append(toks, tk)
+		switch tk.kind {
+		case tDHeredoc, tDHeredocDash:
+			dtk := l.next()
+			toks = append(toks, dtk)
+			delim, quoted := stripDelimQuotes(dtk.val)
+			toks[len(toks)-2].quoted = quoted
+			pending = append(pending, pendingHeredoc{
+				idx:   len(toks) - 2,
+				delim: delim,
+				tabs:  tk.kind == tDHeredocDash,
+			})
+			continue
+		}
+		if (tk.kind == tNewline || tk.kind == tEOF) && len(pending) > 0 {
+			for _, ph := range pending {
+				body, closeIndent := l.readHeredocBody(toks[ph.idx].pos, ph.delim, ph.tabs)
+				toks[ph.idx].heredoc = body
+				toks[ph.idx].closeIndent = closeIndent
+				toks[ph.idx].tabs = ph.tabs
+			}
+			pending = nil
+		}
+		if tk.kind == tEOF {
+			break
+		}
+	}
+	return toks
+}
+
+// stripDelimQuotes reports the effective heredoc delimiter used to find
+// the closing line, and whether it was quoted (which, per POSIX,
+// disables parameter and command substitution within the body).
+func stripDelimQuotes(raw string) (delim string, quoted bool) {
+	if len(raw) >= 2 {
+		if raw[0] == '\'' && raw[len(raw)-1] == '\'' {
+			return raw[1 : len(raw)-1], true
+		}
+		if raw[0] == '"' && raw[len(raw)-1] == '"' {
+			return raw[1 : len(raw)-1], true
+		}
+	}
+	return raw, false
+}
+
+// readHeredocBody reads lines from the lexer's current position (just
+// past the newline that ended the line containing the '<<' operator)
+// up to and including a line that, once stripped of leading tabs when
+// tabs is set, equals delim exactly. It returns the body, excluding the
+// closing delimiter line, along with whatever leading tabs were
+// stripped from that closing line so it can be reprinted verbatim.
+// opPos is the position of the '<<'/'<<-' operator that introduced the
+// heredoc, used to report an unterminated heredoc error.
+func (l *lexer) readHeredocBody(opPos token.Pos, delim string, tabs bool) (body, closeIndent string) {
+	var buf strings.Builder
+	for {
+		lineStart := l.i
+		j := lineStart
+		for j < len(l.src) && l.src[j] != '\n' {
+			j++
+		}
+		line := l.src[lineStart:j]
+		cmp := line
+		if tabs {
+			cmp = strings.TrimLeft(line, "\t")
+		}
+		if cmp == delim {
+			if j < len(l.src) {
+				l.f.AddLine(j + 1)
+				l.i = j + 1
+			} else {
+				l.i = j
+			}
+			return buf.String(), line[:len(line)-len(cmp)]
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+		if j >= len(l.src) {
+			l.i = j
+			l.errorf(opPos, "unterminated heredoc (want %q)", delim)
+		}
+		l.f.AddLine(j + 1)
+		l.i = j + 1
+	}
+}
+
+func (l *lexer) pos() token.Pos { return l.f.Pos(l.i) }
+
+// errorf panics with a *parseError positioned at pos, the same error
+// type the parser itself raises, so that malformed input from the
+// lexer is reported as a normal parse error rather than an uncaught
+// panic.
+func (l *lexer) errorf(pos token.Pos, format string, args ...interface{}) {
+	panic(&parseError{
+		pos: l.fset.Position(pos),
+		msg: fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *lexer) byteAt(off int) byte {
+	if l.i+off >= len(l.src) {
+		return 0
+	}
+	return l.src[l.i+off]
+}
+
+// next scans and returns the next token, advancing the lexer.
+func (l *lexer) next() tok {
+	for {
+		// skip horizontal whitespace
+		for l.i < len(l.src) && (l.src[l.i] == ' ' || l.src[l.i] == '\t') {
+			l.i++
+		}
+		if l.i < len(l.src) && l.src[l.i] == '\\' && l.byteAt(1) == '\n' {
+			l.f.AddLine(l.i + 1)
+			l.i += 2
+			continue
+		}
+		break
+	}
+	if l.i >= len(l.src) {
+		return tok{kind: tEOF, pos: l.pos()}
+	}
+	start := l.i
+	p := l.pos()
+	c := l.src[l.i]
+	switch c {
+	case '\n':
+		l.i++
+		l.f.AddLine(l.i)
+		return tok{kind: tNewline, val: "\n", pos: p}
+	case '#':
+		l.i++
+		for l.i < len(l.src) && l.src[l.i] != '\n' {
+			l.i++
+		}
+		return tok{kind: tComment, val: l.src[start+1 : l.i], pos: p}
+	case ';':
+		l.i++
+		if l.i < len(l.src) && l.src[l.i] == ';' {
+			l.i++
+			return tok{kind: tSemiSemi, val: ";;", pos: p}
+		}
+		return tok{kind: tSemicolon, val: ";", pos: p}
+	case '&':
+		l.i++
+		if l.i < len(l.src) && l.src[l.i] == '&' {
+			l.i++
+			return tok{kind: tAndAnd, val: "&&", pos: p}
+		}
+		return tok{kind: tAmp, val: "&", pos: p}
+	case '|':
+		l.i++
+		if l.i < len(l.src) && l.src[l.i] == '|' {
+			l.i++
+			return tok{kind: tOrOr, val: "||", pos: p}
+		}
+		return tok{kind: tPipe, val: "|", pos: p}
+	case '(':
+		l.i++
+		return tok{kind: tLParen, val: "(", pos: p}
+	case ')':
+		l.i++
+		return tok{kind: tRParen, val: ")", pos: p}
+	case '<':
+		l.i++
+		if l.i < len(l.src) && l.src[l.i] == '<' {
+			l.i++
+			if l.i < len(l.src) && l.src[l.i] == '-' {
+				l.i++
+				return tok{kind: tDHeredocDash, val: "<<-", pos: p}
+			}
+			if l.i < len(l.src) && l.src[l.i] == '<' {
+				l.i++
+				return tok{kind: tHereString, val: "<<<", pos: p}
+			}
+			return tok{kind: tDHeredoc, val: "<<", pos: p}
+		}
+		return tok{kind: tLt, val: "<", pos: p}
+	case '>':
+		l.i++
+		if l.i < len(l.src) && l.src[l.i] == '>' {
+			l.i++
+			return tok{kind: tGtGt, val: ">>", pos: p}
+		}
+		return tok{kind: tGt, val: ">", pos: p}
+	}
+	return l.word(p)
+}
+
+// word scans a single word token, starting at the lexer's current
+// position, building both its flat string value and its structured
+// parts: literal runs (ast.LitPart), single and double quoted sections
+// (ast.SqStringPart, ast.DqStringPart) kept whole including their quote
+// characters in val, and $ and ` expansions (ast.ParamExp,
+// ast.CmdSubst, ast.ArithExpr).
+// Backslash-newline line continuations are dropped from the resulting
+// value without affecting position tracking of what follows.
+func (l *lexer) word(p token.Pos) tok {
+	start := l.i
+	segStart := start
+	var buf []byte
+	cut := func(to int) {
+		buf = append(buf, l.src[segStart:to]...)
+		segStart = to
+	}
+	value := func() string {
+		if buf == nil {
+			return l.src[start:l.i]
+		}
+		cut(l.i)
+		return string(buf)
+	}
+
+	var parts []ast.Node
+	partStart := start
+	flushLitPart := func(to int) {
+		if to > partStart {
+			parts = append(parts, ast.LitPart{ValuePos: l.f.Pos(partStart), Value: l.src[partStart:to]})
+		}
+		partStart = to
+	}
+
+	for l.i < len(l.src) {
+		c := l.src[l.i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			flushLitPart(l.i)
+			return tok{kind: tWord, val: value(), pos: p, parts: parts}
+		case opMeta(c):
+			flushLitPart(l.i)
+			return tok{kind: tWord, val: value(), pos: p, parts: parts}
+		case c == '{' && l.i == start:
+			// A lone '{' at the start of a word is the reserved
+			// block keyword; handled by the parser via its value.
+			l.i++
+			flushLitPart(l.i)
+			return tok{kind: tWord, val: "{", pos: p, parts: parts}
+		case c == '}' && l.i == start:
+			l.i++
+			flushLitPart(l.i)
+			return tok{kind: tWord, val: "}", pos: p, parts: parts}
+		case c == '\\' && l.byteAt(1) == '\n':
+			cut(l.i)
+			flushLitPart(l.i)
+			l.f.AddLine(l.i + 2)
+			l.i += 2
+			segStart = l.i
+			partStart = l.i
+		case c == '\\':
+			l.i += 2
+		case c == '\'':
+			flushLitPart(l.i)
+			qpos := l.pos()
+			l.i++
+			contentStart := l.i
+			for l.i < len(l.src) && l.src[l.i] != '\'' {
+				if l.src[l.i] == '\n' {
+					l.f.AddLine(l.i + 1)
+				}
+				l.i++
+			}
+			if l.i >= len(l.src) {
+				l.errorf(qpos, "unterminated single-quoted string")
+			}
+			content := l.src[contentStart:l.i]
+			l.i++
+			parts = append(parts, ast.SqStringPart{Quote: qpos, Value: content})
+			partStart = l.i
+		case c == '"':
+			flushLitPart(l.i)
+			qpos := l.pos()
+			l.i++
+			innerStart := l.i
+			for l.i < len(l.src) && l.src[l.i] != '"' {
+				if l.src[l.i] == '\\' {
+					l.i++
+				} else if l.src[l.i] == '\n' {
+					l.f.AddLine(l.i + 1)
+				}
+				l.i++
+			}
+			if l.i >= len(l.src) {
+				l.errorf(qpos, "unterminated double-quoted string")
+			}
+			dqParts := l.scanExpParts(innerStart, l.i)
+			l.i++
+			parts = append(parts, ast.DqStringPart{Quote: qpos, Rquote: l.pos() - 1, Parts: dqParts})
+			partStart = l.i
+		case c == '$' && l.i+1 < len(l.src):
+			flushLitPart(l.i)
+			node, newI := l.scanDollar(l.i)
+			parts = append(parts, node)
+			l.i = newI
+			partStart = l.i
+		case c == '`':
+			flushLitPart(l.i)
+			node, newI := l.scanBacktick(l.i)
+			parts = append(parts, node)
+			l.i = newI
+			partStart = l.i
+		default:
+			l.i++
+		}
+	}
+	flushLitPart(l.i)
+	return tok{kind: tWord, val: value(), pos: p, parts: parts}
+}
+
+// scanExpParts scans [start,end) of l.src, which holds no quote
+// characters of its own (e.g. the inside of a double quoted string, or
+// the default value of a parameter expansion), for $ and ` expansions,
+// returning the resulting ordered parts. Backslash escapes are kept
+// literally, as this stage doesn't interpret them.
+func (l *lexer) scanExpParts(start, end int) []ast.Node {
+	var parts []ast.Node
+	runStart := start
+	flush := func(to int) {
+		if to > runStart {
+			parts = append(parts, ast.LitPart{ValuePos: l.f.Pos(runStart), Value: l.src[runStart:to]})
+		}
+	}
+	i := start
+	for i < end {
+		switch {
+		case l.src[i] == '\\' && i+1 < end:
+			i += 2
+		case l.src[i] == '$' && i+1 < end:
+			flush(i)
+			node, newI := l.scanDollar(i)
+			if newI > end {
+				newI = end
+			}
+			parts = append(parts, node)
+			i = newI
+			runStart = i
+		case l.src[i] == '`':
+			flush(i)
+			node, newI := l.scanBacktick(i)
+			if newI > end {
+				newI = end
+			}
+			parts = append(parts, node)
+			i = newI
+			runStart = i
+		default:
+			i++
+		}
+	}
+	flush(end)
+	return parts
+}
+
+// scanDollar scans a single $ expansion starting at l.src[i] == '$',
+// returning the resulting node and the offset just past it.
+func (l *lexer) scanDollar(i int) (ast.Node, int) {
+	dollarPos := l.f.Pos(i)
+	j := i + 1
+	switch {
+	case j+1 < len(l.src) && l.src[j] == '(' && l.src[j+1] == '(':
+		inStart := j + 2
+		close, ok := findMatchingParen(l.src, inStart, 2)
+		if !ok {
+			l.errorf(dollarPos, "unterminated arithmetic expansion")
+		}
+		expr := l.src[inStart : close-1]
+		x := parseArith(expr, l.fset, l.f, inStart)
+		return ast.ArithExpr{Dollar: dollarPos, X: x, Rparen: l.f.Pos(close)}, close + 1
+	case l.src[j] == '(':
+		inStart := j + 1
+		close, ok := findMatchingParen(l.src, inStart, 1)
+		if !ok {
+			l.errorf(dollarPos, "unterminated command substitution")
+		}
+		stmts := l.parseSub(inStart, close)
+		return ast.CmdSubst{Left: dollarPos, Stmts: stmts, Right: l.f.Pos(close)}, close + 1
+	case l.src[j] == '{':
+		inStart := j + 1
+		close, ok := findMatchingBrace(l.src, inStart)
+		if !ok {
+			l.errorf(dollarPos, "unterminated parameter expansion")
+		}
+		name, op, arg := l.parseParamInner(inStart, close)
+		return ast.ParamExp{Dollar: dollarPos, Braced: true, Name: name, Op: op, Arg: arg, Rbrace: l.f.Pos(close)}, close + 1
+	default:
+		name, newI := scanParamName(l.src, j)
+		if name == "" {
+			return ast.LitPart{ValuePos: dollarPos, Value: "$"}, j
+		}
+		return ast.ParamExp{Dollar: dollarPos, Name: name}, newI
+	}
+}
+
+// scanBacktick scans a `...` command substitution starting at
+// l.src[i] == '`', returning the resulting node and the offset just
+// past the closing backtick.
+func (l *lexer) scanBacktick(i int) (ast.Node, int) {
+	openPos := l.f.Pos(i)
+	j := i + 1
+	for j < len(l.src) && l.src[j] != '`' {
+		if l.src[j] == '\\' {
+			j++
+		}
+		j++
+	}
+	if j >= len(l.src) {
+		l.errorf(openPos, "unterminated command substitution")
+	}
+	stmts := l.parseSub(i+1, j)
+	return ast.CmdSubst{Left: openPos, Backtick: true, Stmts: stmts, Right: l.f.Pos(j)}, j + 1
+}
+
+// parseSub recursively lexes and parses the statements found in
+// [start,end) of l.src, as used by a '$(...)' or '`...`' command
+// substitution. It shares l's FileSet and File, so positions stay
+// consistent with the rest of the file being parsed.
+func (l *lexer) parseSub(start, end int) []ast.Node {
+	sub := &lexer{fset: l.fset, f: l.f, src: l.src[:end], i: start}
+	toks := sub.run()
+	p := &parser{f: l.f, fset: l.fset, toks: toks}
+	p.next()
+	return p.stmts()
+}
+
+// findMatchingParen scans src from start, where openCount '(' have
+// already been consumed, and returns the offset of the ')' that
+// brings the paren depth back to zero, or ok == false if src ends
+// first. It does not treat quotes specially; shell code where a
+// quoted string contains an unbalanced paren isn't handled correctly,
+// which this lexer's corpus doesn't need.
+func findMatchingParen(src string, start, openCount int) (off int, ok bool) {
+	depth := openCount
+	i := start
+	for i < len(src) {
+		switch src[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i, true
+			}
+		}
+		i++
+	}
+	return len(src), false
+}
+
+// findMatchingBrace scans src from start, where one '{' has already
+// been consumed, and returns the offset of the matching '}', or
+// ok == false if src ends first.
+func findMatchingBrace(src string, start int) (off int, ok bool) {
+	depth := 1
+	i := start
+	for i < len(src) {
+		switch src[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i, true
+			}
+		}
+		i++
+	}
+	return len(src), false
+}
+
+// paramOps lists the recognised parameter expansion operators, longest
+// first so that e.g. ":-" is matched before "-".
+var paramOps = []string{":-", ":=", ":?", ":+", "##", "%%", "-", "=", "?", "+", "#", "%"}
+
+// parseParamInner parses the inside of a '${...}' expansion, found at
+// [start,end) of l.src: a parameter name, optionally followed by one
+// of paramOps and an argument word.
+func (l *lexer) parseParamInner(start, end int) (name, op string, arg ast.Node) {
+	name, ni := scanParamName(l.src, start)
+	if ni >= end {
+		return name, "", nil
+	}
+	rest := l.src[ni:end]
+	for _, o := range paramOps {
+		if strings.HasPrefix(rest, o) {
+			argParts := l.scanExpParts(ni+len(o), end)
+			return name, o, ast.Word{Parts: argParts}
+		}
+	}
+	return name, "", nil
+}
+
+// scanParamName scans a parameter name starting at src[i]: either a
+// single special parameter character (@ * # ? $ !), a run of digits
+// (a positional parameter), or a run of identifier characters.
+func scanParamName(src string, i int) (string, int) {
+	if i >= len(src) {
+		return "", i
+	}
+	switch c := src[i]; {
+	case c == '@' || c == '*' || c == '#' || c == '?' || c == '$' || c == '!':
+		return string(c), i + 1
+	case c >= '0' && c <= '9':
+		j := i
+		for j < len(src) && src[j] >= '0' && src[j] <= '9' {
+			j++
+		}
+		return src[i:j], j
+	case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		j := i
+		for j < len(src) && isIdentByte(src[j]) {
+			j++
+		}
+		return src[i:j], j
+	}
+	return "", i
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
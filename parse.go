@@ -0,0 +1,472 @@
+// Copyright (c) 2016, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+// Package sh implements a parser and formatter for POSIX-ish shell
+// source code.
+package sh
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/improbable-io/sh/ast"
+	"github.com/improbable-io/sh/token"
+)
+
+// Parse reads shell source from r and returns its parsed form as an
+// *ast.File, recording source positions in fset. name is used as the
+// file name when reporting errors and positions. As with
+// go/parser.ParseFile, callers keep fset so that a node's Pos() or
+// End() can later be turned into a human-readable file:line:column
+// via fset.Position(...).
+func Parse(fset *token.FileSet, r io.Reader, name string) (file *ast.File, err error) {
+	src, rerr := ioutil.ReadAll(r)
+	if rerr != nil {
+		return nil, rerr
+	}
+	f := fset.AddFile(name, len(src))
+	p := &parser{name: name, f: f, fset: fset}
+	defer func() {
+		if r := recover(); r != nil {
+			perr, ok := r.(*parseError)
+			if !ok {
+				panic(r)
+			}
+			file, err = nil, perr
+		}
+	}()
+	p.toks = lex(fset, f, string(src))
+	p.next()
+	file = &ast.File{Name: name}
+	file.Stmts = p.stmts()
+	if p.tok.kind != tEOF {
+		panic(p.errorf("unexpected token %q", p.tok.val))
+	}
+	return file, nil
+}
+
+// parse is kept as the package-internal entry point used by tests that
+// don't care about positions; it builds and discards its own FileSet.
+func parse(r io.Reader, name string) (*ast.File, error) {
+	return Parse(token.NewFileSet(), r, name)
+}
+
+type parseError struct {
+	pos token.Position
+	msg string
+}
+
+func (e *parseError) Error() string {
+	return fmt.Sprintf("%s: %s", e.pos, e.msg)
+}
+
+// parser turns a flat token slice into an *ast.File.
+type parser struct {
+	name string
+	f    *token.File
+	fset *token.FileSet
+
+	toks []tok
+	i    int
+	tok  tok
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return &parseError{
+		pos: p.fset.Position(p.tok.pos),
+		msg: fmt.Sprintf(format, args...),
+	}
+}
+
+// next advances to the next token.
+func (p *parser) next() {
+	p.tok = p.toks[p.i]
+	if p.i < len(p.toks)-1 {
+		p.i++
+	}
+}
+
+func (p *parser) peek() tok {
+	if p.i < len(p.toks) {
+		return p.toks[p.i]
+	}
+	return p.toks[len(p.toks)-1]
+}
+
+func (p *parser) is(kind tokKind) bool { return p.tok.kind == kind }
+
+func (p *parser) isWord(val string) bool {
+	return p.tok.kind == tWord && p.tok.val == val
+}
+
+// skipSeparators consumes any run of ';', '&' and newline tokens. A
+// trailing '&' backgrounds the statement before it; this parser
+// doesn't track that distinction and treats it as a plain separator,
+// same as ';'.
+func (p *parser) skipSeparators() {
+	for p.tok.kind == tSemicolon || p.tok.kind == tAmp || p.tok.kind == tNewline {
+		p.next()
+	}
+}
+
+// stmts parses a list of statements until EOF, a closing ')' or '}',
+// a ';;', or a word token found in end.
+func (p *parser) stmts(end ...string) []ast.Node {
+	var list []ast.Node
+	for {
+		p.skipSeparators()
+		if p.is(tEOF) || p.is(tRParen) || p.is(tSemiSemi) {
+			break
+		}
+		if p.tok.kind == tWord {
+			stop := p.tok.val == "}"
+			for _, e := range end {
+				if p.tok.val == e {
+					stop = true
+					break
+				}
+			}
+			if stop {
+				break
+			}
+		}
+		if p.is(tComment) {
+			list = append(list, ast.Comment{Hash: p.tok.pos, Text: p.tok.val})
+			p.next()
+			continue
+		}
+		list = append(list, p.andOr())
+	}
+	return list
+}
+
+// andOr parses a pipeline, optionally followed by '&&' or '||' and a
+// right-hand side, right-associatively.
+func (p *parser) andOr() ast.Node {
+	left := p.pipeline()
+	if p.tok.kind == tAndAnd || p.tok.kind == tOrOr {
+		op := p.tok.val
+		opPos := p.tok.pos
+		p.next()
+		p.skipSeparators()
+		right := p.andOr()
+		return ast.BinaryExpr{OpPos: opPos, Op: op, X: left, Y: right}
+	}
+	return left
+}
+
+// pipeline parses a single command, optionally followed by '|' and a
+// right-hand side, right-associatively.
+func (p *parser) pipeline() ast.Node {
+	left := p.stmt()
+	if p.tok.kind == tPipe {
+		opPos := p.tok.pos
+		p.next()
+		p.skipSeparators()
+		right := p.pipeline()
+		return ast.BinaryExpr{OpPos: opPos, Op: "|", X: left, Y: right}
+	}
+	return left
+}
+
+// stmt parses a single compound or simple statement.
+func (p *parser) stmt() ast.Node {
+	switch {
+	case p.is(tLParen):
+		return p.subshell()
+	case p.isWord("{"):
+		return p.block()
+	case p.isWord("if"):
+		return p.ifStmt()
+	case p.isWord("while"):
+		return p.whileStmt()
+	case p.isWord("until"):
+		return p.untilStmt()
+	case p.isWord("for"):
+		return p.forStmt()
+	case p.isWord("case"):
+		return p.caseStmt()
+	case p.tok.kind == tWord:
+		if pk := p.peek(); pk.kind == tLParen {
+			idx2 := p.i + 1
+			if idx2 >= len(p.toks) {
+				idx2 = len(p.toks) - 1
+			}
+			if p.toks[idx2].kind == tRParen {
+				return p.funcDecl()
+			}
+		}
+		return p.command()
+	default:
+		panic(p.errorf("unexpected token %q", p.tok.val))
+	}
+}
+
+func (p *parser) subshell() ast.Node {
+	lparen := p.tok.pos
+	p.next()
+	stmts := p.stmts()
+	if !p.is(tRParen) {
+		panic(p.errorf("expected ')'"))
+	}
+	rparen := p.tok.pos
+	p.next()
+	return ast.Subshell{Lparen: lparen, Rparen: rparen, Stmts: stmts}
+}
+
+func (p *parser) block() ast.Node {
+	lbrace := p.tok.pos
+	p.next()
+	stmts := p.stmts()
+	if !p.isWord("}") {
+		panic(p.errorf("expected '}'"))
+	}
+	rbrace := p.tok.pos
+	p.next()
+	return ast.Block{Lbrace: lbrace, Rbrace: rbrace, Stmts: stmts}
+}
+
+func (p *parser) ifStmt() ast.Node {
+	ifPos := p.tok.pos
+	p.next()
+	cond := p.andOr()
+	p.skipSeparators()
+	if !p.isWord("then") {
+		panic(p.errorf("expected 'then'"))
+	}
+	thenPos := p.tok.pos
+	p.next()
+	thenStmts := p.stmts("elif", "else", "fi")
+	var elifs []ast.Node
+	for p.isWord("elif") {
+		elifPos := p.tok.pos
+		p.next()
+		econd := p.andOr()
+		p.skipSeparators()
+		if !p.isWord("then") {
+			panic(p.errorf("expected 'then'"))
+		}
+		ethenPos := p.tok.pos
+		p.next()
+		ethenStmts := p.stmts("elif", "else", "fi")
+		elifs = append(elifs, ast.Elif{Elif: elifPos, Cond: econd, Then: ethenPos, ThenStmts: ethenStmts})
+	}
+	var elsePos token.Pos
+	var elseStmts []ast.Node
+	if p.isWord("else") {
+		elsePos = p.tok.pos
+		p.next()
+		elseStmts = p.stmts("fi")
+	}
+	if !p.isWord("fi") {
+		panic(p.errorf("expected 'fi'"))
+	}
+	fiPos := p.tok.pos
+	p.next()
+	return ast.IfStmt{
+		If: ifPos, Fi: fiPos,
+		Cond:      cond,
+		Then:      thenPos,
+		ThenStmts: thenStmts,
+		Elifs:     elifs,
+		Else:      elsePos,
+		ElseStmts: elseStmts,
+	}
+}
+
+func (p *parser) whileStmt() ast.Node {
+	whilePos := p.tok.pos
+	p.next()
+	cond := p.andOr()
+	p.skipSeparators()
+	if !p.isWord("do") {
+		panic(p.errorf("expected 'do'"))
+	}
+	doPos := p.tok.pos
+	p.next()
+	doStmts := p.stmts("done")
+	if !p.isWord("done") {
+		panic(p.errorf("expected 'done'"))
+	}
+	donePos := p.tok.pos
+	p.next()
+	return ast.WhileStmt{While: whilePos, Done: donePos, Cond: cond, Do: doPos, DoStmts: doStmts}
+}
+
+func (p *parser) untilStmt() ast.Node {
+	untilPos := p.tok.pos
+	p.next()
+	cond := p.andOr()
+	p.skipSeparators()
+	if !p.isWord("do") {
+		panic(p.errorf("expected 'do'"))
+	}
+	doPos := p.tok.pos
+	p.next()
+	doStmts := p.stmts("done")
+	if !p.isWord("done") {
+		panic(p.errorf("expected 'done'"))
+	}
+	donePos := p.tok.pos
+	p.next()
+	return ast.UntilStmt{Until: untilPos, Done: donePos, Cond: cond, Do: doPos, DoStmts: doStmts}
+}
+
+// forStmt parses 'for name in word...; do ...; done' as well as its
+// 'for name; do ...; done' shorthand, which iterates over "$@".
+func (p *parser) forStmt() ast.Node {
+	forPos := p.tok.pos
+	p.next()
+	if p.tok.kind != tWord {
+		panic(p.errorf("expected name after 'for'"))
+	}
+	name := ast.Lit{ValuePos: p.tok.pos, Value: p.tok.val}
+	p.next()
+	var hasIn bool
+	var wordList []ast.Node
+	if p.isWord("in") {
+		hasIn = true
+		p.next()
+		for p.tok.kind == tWord {
+			wordList = append(wordList, ast.Word{Parts: p.tok.parts})
+			p.next()
+		}
+	}
+	p.skipSeparators()
+	if !p.isWord("do") {
+		panic(p.errorf("expected 'do'"))
+	}
+	doPos := p.tok.pos
+	p.next()
+	doStmts := p.stmts("done")
+	if !p.isWord("done") {
+		panic(p.errorf("expected 'done'"))
+	}
+	donePos := p.tok.pos
+	p.next()
+	return ast.ForStmt{
+		For: forPos, Done: donePos,
+		Name:     name,
+		In:       hasIn,
+		WordList: wordList,
+		Do:       doPos,
+		DoStmts:  doStmts,
+	}
+}
+
+func (p *parser) caseStmt() ast.Node {
+	casePos := p.tok.pos
+	p.next()
+	if p.tok.kind != tWord {
+		panic(p.errorf("expected word after 'case'"))
+	}
+	word := ast.Word{Parts: p.tok.parts}
+	p.next()
+	p.skipSeparators()
+	if !p.isWord("in") {
+		panic(p.errorf("expected 'in'"))
+	}
+	inPos := p.tok.pos
+	p.next()
+	p.skipSeparators()
+	var items []ast.Node
+	for !p.isWord("esac") && !p.is(tEOF) {
+		items = append(items, p.patternClause())
+		p.skipSeparators()
+	}
+	if !p.isWord("esac") {
+		panic(p.errorf("expected 'esac'"))
+	}
+	esacPos := p.tok.pos
+	p.next()
+	return ast.CaseStmt{Case: casePos, Esac: esacPos, Word: word, In: inPos, Items: items}
+}
+
+// patternClause parses a single 'pat1|pat2) stmts;;' clause of a case
+// statement. A leading '(' before the first pattern is allowed, as
+// POSIX permits it for readability.
+func (p *parser) patternClause() ast.Node {
+	if p.is(tLParen) {
+		p.next()
+	}
+	var pats []ast.Node
+	for {
+		if p.tok.kind != tWord {
+			panic(p.errorf("expected case pattern"))
+		}
+		pats = append(pats, ast.Word{Parts: p.tok.parts})
+		p.next()
+		if p.tok.kind == tPipe {
+			p.next()
+			continue
+		}
+		break
+	}
+	if !p.is(tRParen) {
+		panic(p.errorf("expected ')'"))
+	}
+	rparen := p.tok.pos
+	p.next()
+	stmts := p.stmts("esac")
+	var dsemi token.Pos
+	var terminated bool
+	if p.is(tSemiSemi) {
+		dsemi = p.tok.pos
+		terminated = true
+		p.next()
+	}
+	return ast.PatternClause{Patterns: pats, Rparen: rparen, Stmts: stmts, DSemi: dsemi, Terminated: terminated}
+}
+
+func (p *parser) funcDecl() ast.Node {
+	name := ast.Lit{ValuePos: p.tok.pos, Value: p.tok.val}
+	p.next()
+	lparen := p.tok.pos
+	p.next()
+	rparen := p.tok.pos
+	p.next()
+	body := p.stmt()
+	return ast.FuncDecl{Name: name, Lparen: lparen, Rparen: rparen, Body: body}
+}
+
+// command parses a simple command: a run of words and redirects.
+func (p *parser) command() ast.Node {
+	var args []ast.Node
+	for {
+		switch p.tok.kind {
+		case tWord:
+			args = append(args, ast.Word{Parts: p.tok.parts})
+			p.next()
+		case tGt, tGtGt, tLt, tHereString:
+			op := p.tok.val
+			opPos := p.tok.pos
+			p.next()
+			if p.tok.kind != tWord {
+				panic(p.errorf("expected word after %q", op))
+			}
+			obj := ast.Word{Parts: p.tok.parts}
+			p.next()
+			args = append(args, ast.Redirect{OpPos: opPos, Op: op, Obj: obj})
+		case tDHeredoc, tDHeredocDash:
+			op := p.tok.val
+			opPos := p.tok.pos
+			heredoc := p.tok.heredoc
+			closeIndent := p.tok.closeIndent
+			tabs := p.tok.kind == tDHeredocDash
+			quoted := p.tok.quoted
+			p.next()
+			if p.tok.kind != tWord {
+				panic(p.errorf("expected word after %q", op))
+			}
+			obj := ast.Word{Parts: p.tok.parts}
+			p.next()
+			args = append(args, ast.Redirect{
+				OpPos: opPos, Op: op, Obj: obj,
+				Heredoc: heredoc, CloseIndent: closeIndent, Tabs: tabs, Quoted: quoted,
+			})
+		default:
+			return ast.Command{Args: args}
+		}
+	}
+}
@@ -0,0 +1,677 @@
+// Copyright (c) 2016, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package sh
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/improbable-io/sh/ast"
+	"github.com/improbable-io/sh/token"
+)
+
+// lits builds a slice of purely-literal command arguments. Each string
+// becomes an ast.Word wrapping a single ast.LitPart, which is what the
+// parser now produces for any word without quotes or expansions in it.
+func lits(strs ...string) []ast.Node {
+	l := make([]ast.Node, 0, len(strs))
+	for _, s := range strs {
+		l = append(l, ast.Word{Parts: []ast.Node{ast.LitPart{Value: s}}})
+	}
+	return l
+}
+
+// word is a small builder for command arguments made up of more than
+// one part, e.g. a mix of literal text and an expansion.
+func word(parts ...ast.Node) ast.Node {
+	return ast.Word{Parts: parts}
+}
+
+// testCases follow the desc/in/out convention used by other Go
+// parsers such as cuelang.org/go/cue/parser: desc is a short label,
+// ins holds equivalent source forms, and want is the expected AST
+// once all position information has been stripped (see stripPos).
+var testCases = []struct {
+	desc string
+	ins  []string
+	want interface{}
+}{
+	{
+		desc: "empty",
+		ins:  []string{"", " ", "\n"},
+		want: nil,
+	},
+	{
+		desc: "comment",
+		ins:  []string{"# foo", "# foo\n"},
+		want: ast.Comment{Text: " foo"},
+	},
+	{
+		desc: "one word",
+		ins:  []string{"foo", "foo ", " foo"},
+		want: ast.Command{Args: lits("foo")},
+	},
+	{
+		desc: "two commands",
+		ins:  []string{"foo; bar", "foo; bar;", "\nfoo\nbar\n"},
+		want: []ast.Node{
+			ast.Command{Args: lits("foo")},
+			ast.Command{Args: lits("bar")},
+		},
+	},
+	{
+		desc: "several words",
+		ins:  []string{"foo a b", " foo  a  b ", "foo \\\n a b"},
+		want: ast.Command{Args: lits("foo", "a", "b")},
+	},
+	{
+		desc: "background separator",
+		ins:  []string{"foo; bar", "foo & bar"},
+		want: []ast.Node{
+			ast.Command{Args: lits("foo")},
+			ast.Command{Args: lits("bar")},
+		},
+	},
+	{
+		desc: "trailing background",
+		ins:  []string{"foo", "foo &"},
+		want: ast.Command{Args: lits("foo")},
+	},
+	{
+		desc: "subshell",
+		ins:  []string{"( foo; )", "(foo;)", "(\nfoo\n)"},
+		want: ast.Subshell{Stmts: []ast.Node{
+			ast.Command{Args: lits("foo")},
+		}},
+	},
+	{
+		desc: "block",
+		ins:  []string{"{ foo; }", "{foo;}", "{\nfoo\n}"},
+		want: ast.Block{Stmts: []ast.Node{
+			ast.Command{Args: lits("foo")},
+		}},
+	},
+	{
+		desc: "if",
+		ins: []string{
+			"if a; then b; fi",
+			"if a\nthen\nb\nfi",
+		},
+		want: ast.IfStmt{
+			Cond: ast.Command{Args: lits("a")},
+			ThenStmts: []ast.Node{
+				ast.Command{Args: lits("b")},
+			},
+		},
+	},
+	{
+		desc: "if else",
+		ins: []string{
+			"if a; then b; else c; fi",
+			"if a\nthen b\nelse\nc\nfi",
+		},
+		want: ast.IfStmt{
+			Cond: ast.Command{Args: lits("a")},
+			ThenStmts: []ast.Node{
+				ast.Command{Args: lits("b")},
+			},
+			ElseStmts: []ast.Node{
+				ast.Command{Args: lits("c")},
+			},
+		},
+	},
+	{
+		desc: "if elif else",
+		ins: []string{
+			"if a; then a; elif b; then b; elif c; then c; else d; fi",
+			"if a\nthen a\nelif b\nthen b\nelif c\nthen c\nelse\nd\nfi",
+		},
+		want: ast.IfStmt{
+			Cond: ast.Command{Args: lits("a")},
+			ThenStmts: []ast.Node{
+				ast.Command{Args: lits("a")},
+			},
+			Elifs: []ast.Node{
+				ast.Elif{Cond: ast.Command{Args: lits("b")},
+					ThenStmts: []ast.Node{
+						ast.Command{Args: lits("b")},
+					}},
+				ast.Elif{Cond: ast.Command{Args: lits("c")},
+					ThenStmts: []ast.Node{
+						ast.Command{Args: lits("c")},
+					}},
+			},
+			ElseStmts: []ast.Node{
+				ast.Command{Args: lits("d")},
+			},
+		},
+	},
+	{
+		desc: "while",
+		ins:  []string{"while a; do b; done", "while a\ndo\nb\ndone"},
+		want: ast.WhileStmt{
+			Cond: ast.Command{Args: lits("a")},
+			DoStmts: []ast.Node{
+				ast.Command{Args: lits("b")},
+			},
+		},
+	},
+	{
+		desc: "quoted words",
+		ins:  []string{"echo ' ' \"foo bar\""},
+		want: ast.Command{Args: []ast.Node{
+			lits("echo")[0],
+			word(ast.SqStringPart{Value: " "}),
+			word(ast.DqStringPart{Parts: []ast.Node{ast.LitPart{Value: "foo bar"}}}),
+		}},
+	},
+	{
+		desc: "braces mid-word stay literal",
+		ins:  []string{"s{s s=s"},
+		want: ast.Command{Args: lits("s{s", "s=s")},
+	},
+	{
+		desc: "bare parameter expansion",
+		ins:  []string{"echo $a"},
+		want: ast.Command{Args: []ast.Node{
+			lits("echo")[0],
+			word(ast.ParamExp{Name: "a"}),
+		}},
+	},
+	{
+		desc: "braced parameter expansion",
+		ins:  []string{"echo ${b}"},
+		want: ast.Command{Args: []ast.Node{
+			lits("echo")[0],
+			word(ast.ParamExp{Name: "b", Braced: true}),
+		}},
+	},
+	{
+		desc: "parameter expansion with default",
+		ins:  []string{"echo ${b:-default}"},
+		want: ast.Command{Args: []ast.Node{
+			lits("echo")[0],
+			word(ast.ParamExp{
+				Name: "b", Braced: true, Op: ":-",
+				Arg: ast.Word{Parts: []ast.Node{ast.LitPart{Value: "default"}}},
+			}),
+		}},
+	},
+	{
+		desc: "parameter expansion stripping a prefix pattern",
+		ins:  []string{"echo ${b#pat}"},
+		want: ast.Command{Args: []ast.Node{
+			lits("echo")[0],
+			word(ast.ParamExp{
+				Name: "b", Braced: true, Op: "#",
+				Arg: ast.Word{Parts: []ast.Node{ast.LitPart{Value: "pat"}}},
+			}),
+		}},
+	},
+	{
+		desc: "command substitution",
+		ins:  []string{"echo $(echo foo)"},
+		want: ast.Command{Args: []ast.Node{
+			lits("echo")[0],
+			word(ast.CmdSubst{Stmts: []ast.Node{
+				ast.Command{Args: lits("echo", "foo")},
+			}}),
+		}},
+	},
+	{
+		desc: "backtick command substitution",
+		ins:  []string{"echo `echo foo`"},
+		want: ast.Command{Args: []ast.Node{
+			lits("echo")[0],
+			word(ast.CmdSubst{Backtick: true, Stmts: []ast.Node{
+				ast.Command{Args: lits("echo", "foo")},
+			}}),
+		}},
+	},
+	{
+		desc: "arithmetic expansion",
+		ins:  []string{"echo $((1+2))"},
+		want: ast.Command{Args: []ast.Node{
+			lits("echo")[0],
+			word(ast.ArithExpr{X: ast.ArithBinaryExpr{
+				Op: "+",
+				X:  ast.ArithLit{Value: "1"},
+				Y:  ast.ArithLit{Value: "2"},
+			}}),
+		}},
+	},
+	{
+		desc: "nested command and arithmetic substitution in a double quoted word",
+		ins:  []string{"echo \"$(echo $((1+2)))\""},
+		want: ast.Command{Args: []ast.Node{
+			lits("echo")[0],
+			word(ast.DqStringPart{Parts: []ast.Node{
+				ast.CmdSubst{Stmts: []ast.Node{
+					ast.Command{Args: []ast.Node{
+						lits("echo")[0],
+						word(ast.ArithExpr{X: ast.ArithBinaryExpr{
+							Op: "+",
+							X:  ast.ArithLit{Value: "1"},
+							Y:  ast.ArithLit{Value: "2"},
+						}}),
+					}},
+				}},
+			}}),
+		}},
+	},
+	{
+		desc: "and",
+		ins:  []string{"foo && bar", "foo&&bar", "foo &&\nbar"},
+		want: ast.BinaryExpr{
+			Op: "&&",
+			X:  ast.Command{Args: lits("foo")},
+			Y:  ast.Command{Args: lits("bar")},
+		},
+	},
+	{
+		desc: "or",
+		ins:  []string{"foo || bar", "foo||bar", "foo ||\nbar"},
+		want: ast.BinaryExpr{
+			Op: "||",
+			X:  ast.Command{Args: lits("foo")},
+			Y:  ast.Command{Args: lits("bar")},
+		},
+	},
+	{
+		desc: "and then or, right associative",
+		ins:  []string{"foo && bar || else"},
+		want: ast.BinaryExpr{
+			Op: "&&",
+			X:  ast.Command{Args: lits("foo")},
+			Y: ast.BinaryExpr{
+				Op: "||",
+				X:  ast.Command{Args: lits("bar")},
+				Y:  ast.Command{Args: lits("else")},
+			},
+		},
+	},
+	{
+		desc: "pipe",
+		ins:  []string{"foo | bar"},
+		want: ast.BinaryExpr{
+			Op: "|",
+			X:  ast.Command{Args: lits("foo")},
+			Y:  ast.Command{Args: lits("bar")},
+		},
+	},
+	{
+		desc: "pipe chain, right associative",
+		ins:  []string{"foo | bar | extra"},
+		want: ast.BinaryExpr{
+			Op: "|",
+			X:  ast.Command{Args: lits("foo")},
+			Y: ast.BinaryExpr{
+				Op: "|",
+				X:  ast.Command{Args: lits("bar")},
+				Y:  ast.Command{Args: lits("extra")},
+			},
+		},
+	},
+	{
+		desc: "func decl",
+		ins: []string{
+			"foo() { a; b; }",
+			"foo() {\na\nb\n}",
+			"foo ( ) {\na\nb\n}",
+		},
+		want: ast.FuncDecl{
+			Name: ast.Lit{Value: "foo"},
+			Body: ast.Block{Stmts: []ast.Node{
+				ast.Command{Args: lits("a")},
+				ast.Command{Args: lits("b")},
+			}},
+		},
+	},
+	{
+		desc: "redirects",
+		ins: []string{
+			"foo >a >>b <c",
+			"foo > a >> b < c",
+		},
+		want: ast.Command{
+			Args: []ast.Node{
+				lits("foo")[0],
+				ast.Redirect{Op: ">", Obj: lits("a")[0]},
+				ast.Redirect{Op: ">>", Obj: lits("b")[0]},
+				ast.Redirect{Op: "<", Obj: lits("c")[0]},
+			},
+		},
+	},
+	{
+		desc: "until",
+		ins:  []string{"until a; do b; done", "until a\ndo\nb\ndone"},
+		want: ast.UntilStmt{
+			Cond: ast.Command{Args: lits("a")},
+			DoStmts: []ast.Node{
+				ast.Command{Args: lits("b")},
+			},
+		},
+	},
+	{
+		desc: "for with word list",
+		ins: []string{
+			"for i in a b c; do foo; done",
+			"for i in a b c\ndo\nfoo\ndone",
+		},
+		want: ast.ForStmt{
+			Name: ast.Lit{Value: "i"},
+			In:   true,
+			WordList: []ast.Node{
+				lits("a")[0],
+				lits("b")[0],
+				lits("c")[0],
+			},
+			DoStmts: []ast.Node{
+				ast.Command{Args: lits("foo")},
+			},
+		},
+	},
+	{
+		desc: "for shorthand over $@",
+		ins: []string{
+			"for i; do foo; done",
+			"for i\ndo\nfoo\ndone",
+		},
+		want: ast.ForStmt{
+			Name: ast.Lit{Value: "i"},
+			DoStmts: []ast.Node{
+				ast.Command{Args: lits("foo")},
+			},
+		},
+	},
+	{
+		desc: "case with multiple patterns",
+		ins: []string{
+			"case a in x|y) foo;; *) bar;; esac",
+			"case a in\nx|y)\nfoo\n;;\n*)\nbar\n;;\nesac",
+		},
+		want: ast.CaseStmt{
+			Word: lits("a")[0],
+			Items: []ast.Node{
+				ast.PatternClause{
+					Patterns: []ast.Node{
+						lits("x")[0],
+						lits("y")[0],
+					},
+					Stmts: []ast.Node{
+						ast.Command{Args: lits("foo")},
+					},
+					Terminated: true,
+				},
+				ast.PatternClause{
+					Patterns: []ast.Node{
+						lits("*")[0],
+					},
+					Stmts: []ast.Node{
+						ast.Command{Args: lits("bar")},
+					},
+					Terminated: true,
+				},
+			},
+		},
+	},
+	{
+		desc: "heredoc",
+		ins: []string{
+			"cat <<EOF\nhello\nEOF",
+		},
+		want: ast.Command{
+			Args: []ast.Node{
+				lits("cat")[0],
+				ast.Redirect{Op: "<<", Obj: lits("EOF")[0], Heredoc: "hello\n"},
+			},
+		},
+	},
+	{
+		desc: "heredoc with tab stripping",
+		ins: []string{
+			"cat <<-EOF\n\thello\n\tEOF",
+		},
+		want: ast.Command{
+			Args: []ast.Node{
+				lits("cat")[0],
+				ast.Redirect{Op: "<<-", Obj: lits("EOF")[0], Heredoc: "\thello\n", CloseIndent: "\t", Tabs: true},
+			},
+		},
+	},
+	{
+		desc: "heredoc with quoted delimiter",
+		ins: []string{
+			"cat <<'EOF'\n$x\nEOF",
+		},
+		want: ast.Command{
+			Args: []ast.Node{
+				lits("cat")[0],
+				ast.Redirect{Op: "<<", Obj: word(ast.SqStringPart{Value: "EOF"}), Heredoc: "$x\n", Quoted: true},
+			},
+		},
+	},
+	{
+		desc: "here-string",
+		ins: []string{
+			"cat <<<foo",
+			"cat <<< foo",
+		},
+		want: ast.Command{
+			Args: []ast.Node{
+				lits("cat")[0],
+				ast.Redirect{Op: "<<<", Obj: lits("foo")[0]},
+			},
+		},
+	},
+	{
+		desc: "expansion in a for word list",
+		ins:  []string{"for f in $(ls); do foo; done"},
+		want: ast.ForStmt{
+			Name: ast.Lit{Value: "f"},
+			In:   true,
+			WordList: []ast.Node{
+				word(ast.CmdSubst{Stmts: []ast.Node{
+					ast.Command{Args: lits("ls")},
+				}}),
+			},
+			DoStmts: []ast.Node{
+				ast.Command{Args: lits("foo")},
+			},
+		},
+	},
+	{
+		desc: "expansion in a case word",
+		ins:  []string{`case "$1" in a) foo;; esac`},
+		want: ast.CaseStmt{
+			Word: word(ast.DqStringPart{Parts: []ast.Node{ast.ParamExp{Name: "1"}}}),
+			Items: []ast.Node{
+				ast.PatternClause{
+					Patterns: []ast.Node{lits("a")[0]},
+					Stmts: []ast.Node{
+						ast.Command{Args: lits("foo")},
+					},
+					Terminated: true,
+				},
+			},
+		},
+	},
+	{
+		desc: "expansion in a redirect object",
+		ins:  []string{`cmd >"$out"`, `cmd > "$out"`},
+		want: ast.Command{Args: []ast.Node{
+			lits("cmd")[0],
+			ast.Redirect{
+				Op:  ">",
+				Obj: word(ast.DqStringPart{Parts: []ast.Node{ast.ParamExp{Name: "out"}}}),
+			},
+		}},
+	},
+}
+
+func wantedFile(v interface{}) *ast.File {
+	f := &ast.File{}
+	switch x := v.(type) {
+	case []ast.Node:
+		f.Stmts = x
+	case ast.Node:
+		f.Stmts = append(f.Stmts, x)
+	}
+	return f
+}
+
+// stripPos zeroes every token.Pos field found within v, recursively, so
+// that ASTs produced by the parser can be compared against table
+// literals that don't set position fields.
+func stripPos(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			if v.Kind() == reflect.Interface {
+				e := reflect.New(v.Elem().Type()).Elem()
+				e.Set(v.Elem())
+				stripPos(e)
+				v.Set(e)
+			} else {
+				stripPos(v.Elem())
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Field(i)
+			if !f.CanSet() {
+				continue
+			}
+			if f.Type() == reflect.TypeOf(token.Pos(0)) {
+				f.SetInt(0)
+				continue
+			}
+			stripPos(f)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			stripPos(v.Index(i))
+		}
+	}
+}
+
+func clearPos(n ast.Node) ast.Node {
+	v := reflect.New(reflect.TypeOf(n)).Elem()
+	v.Set(reflect.ValueOf(n))
+	stripPos(v)
+	return v.Interface().(ast.Node)
+}
+
+func clearFilePos(f *ast.File) *ast.File {
+	out := &ast.File{Name: f.Name}
+	for _, s := range f.Stmts {
+		out.Stmts = append(out.Stmts, clearPos(s))
+	}
+	return out
+}
+
+func TestParseAST(t *testing.T) {
+	for _, c := range testCases {
+		want := wantedFile(c.want)
+		for _, in := range c.ins {
+			got, err := parse(strings.NewReader(in), "")
+			if err != nil {
+				t.Fatalf("%s: unexpected error in %q: %v", c.desc, in, err)
+			}
+			got = clearFilePos(got)
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("%s: AST mismatch in %q\nwant: %s\ngot:  %s\ndumps:\n%#v\n%#v",
+					c.desc, in, want.String(), got.String(), want, got)
+			}
+		}
+	}
+}
+
+func TestPrintAST(t *testing.T) {
+	for _, c := range testCases {
+		in := wantedFile(c.want)
+		want := c.ins[0]
+		got := in.String()
+		if got != want {
+			t.Fatalf("%s: AST print mismatch\nwant: %s\ngot:  %s", c.desc, want, got)
+		}
+	}
+}
+
+// TestPositions checks that a handful of representative nodes carry
+// the exact source offsets we expect, now that the lexer and parser
+// attach token.Pos values as they go.
+func TestPositions(t *testing.T) {
+	posTests := []struct {
+		in   string
+		node func(f *ast.File) ast.Node
+		pos  int
+		end  int
+	}{
+		{
+			in:   "foo",
+			node: func(f *ast.File) ast.Node { return f.Stmts[0] },
+			pos:  0,
+			end:  3,
+		},
+		{
+			in:   "foo bar",
+			node: func(f *ast.File) ast.Node { return f.Stmts[0].(ast.Command).Args[1] },
+			pos:  4,
+			end:  7,
+		},
+		{
+			in:   "foo; bar",
+			node: func(f *ast.File) ast.Node { return f.Stmts[1] },
+			pos:  5,
+			end:  8,
+		},
+		{
+			in:   "# a comment",
+			node: func(f *ast.File) ast.Node { return f.Stmts[0] },
+			pos:  0,
+			end:  11,
+		},
+	}
+	for _, pt := range posTests {
+		fset := token.NewFileSet()
+		f, err := Parse(fset, strings.NewReader(pt.in), "positions.sh")
+		if err != nil {
+			t.Fatalf("unexpected error in %q: %v", pt.in, err)
+		}
+		n := pt.node(f)
+		wantPos := token.Position{Filename: "positions.sh", Offset: pt.pos, Line: 1, Column: pt.pos + 1}
+		if got := fset.Position(n.Pos()); got != wantPos {
+			t.Errorf("%q: fset.Position(Pos()) = %+v, want %+v", pt.in, got, wantPos)
+		}
+		wantEnd := token.Position{Filename: "positions.sh", Offset: pt.end, Line: 1, Column: pt.end + 1}
+		if got := fset.Position(n.End()); got != wantEnd {
+			t.Errorf("%q: fset.Position(End()) = %+v, want %+v", pt.in, got, wantEnd)
+		}
+	}
+}
+
+// TestParseErrors checks that malformed or truncated input, as routinely
+// seen by a parser backing a linter or editor, is reported as an error
+// rather than panicking.
+func TestParseErrors(t *testing.T) {
+	errTests := []string{
+		"echo $((",
+		"echo $((1+",
+		"echo $(foo",
+		"echo `foo",
+		"echo ${foo",
+		`echo "unterminated`,
+		"echo 'unterminated",
+		"echo $((1+))",
+		"echo $(( ))",
+		"cat <<EOF\nhello\nworld\n",
+	}
+	for _, in := range errTests {
+		if _, err := parse(strings.NewReader(in), ""); err == nil {
+			t.Errorf("%q: expected a parse error, got nil", in)
+		}
+	}
+}
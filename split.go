@@ -0,0 +1,164 @@
+// Copyright (c) 2016, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package sh
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Split tokenises s into words using the same rules the parser applies
+// to a command's arguments: single quotes are kept literal, double
+// quotes allow the \", \\, \$ and \` escapes (any other backslash inside
+// them is kept), an unquoted backslash followed by any other character
+// is an escape that drops the backslash, a backslash-newline is a line
+// continuation that is simply dropped, and unquoted whitespace
+// separates words. Unlike the parser's ast.Word nodes,
+// the words returned here have their quotes and escapes already
+// resolved, in the style of github.com/google/shlex.
+func Split(s string) ([]string, error) {
+	var words []string
+	i := 0
+	for {
+		for i < len(s) && isSplitSpace(s[i]) {
+			i++
+		}
+		if i < len(s) && s[i] == '\\' && i+1 < len(s) && s[i+1] == '\n' {
+			i += 2
+			continue
+		}
+		if i >= len(s) {
+			return words, nil
+		}
+		word, newI, err := splitWord(s, i)
+		if err != nil {
+			return nil, err
+		}
+		words = append(words, word)
+		i = newI
+	}
+}
+
+func isSplitSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+// splitWord scans a single word starting at s[i], returning its
+// unescaped value and the offset just past it.
+func splitWord(s string, i int) (string, int, error) {
+	var b strings.Builder
+	for i < len(s) && !isSplitSpace(s[i]) {
+		switch s[i] {
+		case '\'':
+			j := strings.IndexByte(s[i+1:], '\'')
+			if j < 0 {
+				return "", i, fmt.Errorf("sh: unterminated single-quoted string")
+			}
+			b.WriteString(s[i+1 : i+1+j])
+			i += j + 2
+		case '"':
+			content, newI, err := splitDquote(s, i+1)
+			if err != nil {
+				return "", i, err
+			}
+			b.WriteString(content)
+			i = newI
+		case '\\':
+			if i+1 >= len(s) {
+				return "", i, fmt.Errorf("sh: trailing backslash")
+			}
+			if s[i+1] == '\n' {
+				i += 2
+				continue
+			}
+			b.WriteByte(s[i+1])
+			i += 2
+		default:
+			b.WriteByte(s[i])
+			i++
+		}
+	}
+	return b.String(), i, nil
+}
+
+// splitDquote scans the inside of a double-quoted string starting at
+// s[i], just past the opening '"', returning its unescaped value and
+// the offset just past the closing '"'.
+func splitDquote(s string, i int) (string, int, error) {
+	var b strings.Builder
+	for {
+		if i >= len(s) {
+			return "", i, fmt.Errorf("sh: unterminated double-quoted string")
+		}
+		switch s[i] {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			if i+1 < len(s) && s[i+1] == '\n' {
+				i += 2
+				continue
+			}
+			if i+1 < len(s) && strings.IndexByte(`"\$`+"`", s[i+1]) >= 0 {
+				b.WriteByte(s[i+1])
+				i += 2
+				continue
+			}
+			b.WriteByte(s[i])
+			i++
+		default:
+			b.WriteByte(s[i])
+			i++
+		}
+	}
+}
+
+// joinSafe lists the characters that never need quoting when joining a
+// word back into a command line.
+const joinSafe = "_-./,:@%+=~^"
+
+// Join produces a command line that, when run through Split, yields
+// words back, quoting each one minimally: a non-empty word with no
+// characters that are special to the shell is left bare, one containing no
+// single quote is wrapped in single quotes, and anything else is
+// double-quoted with '"', '\\', '$' and '`' escaped.
+func Join(words []string) string {
+	parts := make([]string, len(words))
+	for i, w := range words {
+		parts[i] = quoteWord(w)
+	}
+	return strings.Join(parts, " ")
+}
+
+func quoteWord(w string) string {
+	if w != "" && !needsQuote(w) {
+		return w
+	}
+	if !strings.ContainsRune(w, '\'') {
+		return "'" + w + "'"
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(w); i++ {
+		c := w[i]
+		if strings.IndexByte(`"\$`+"`", c) >= 0 {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func needsQuote(w string) bool {
+	for i := 0; i < len(w); i++ {
+		c := w[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.IndexByte(joinSafe, c) >= 0:
+		default:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2016, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package sh
+
+import (
+	"reflect"
+	"testing"
+)
+
+var splitTests = []struct {
+	desc string
+	in   string
+	want []string
+}{
+	{"empty", "", nil},
+	{"blank", "   \t  ", nil},
+	{"plain words", "foo bar baz", []string{"foo", "bar", "baz"}},
+	{"extra spaces", "  foo   bar  ", []string{"foo", "bar"}},
+	{"single quotes", `'foo bar' baz`, []string{"foo bar", "baz"}},
+	{"double quotes", `"foo bar" baz`, []string{"foo bar", "baz"}},
+	{"double quote escapes", "\"a\\\"b\\\\c\\$d\\`e\"", []string{"a\"b\\c$d`e"}},
+	{"unquoted escape", `foo\ bar`, []string{"foo bar"}},
+	{"line continuation between words", "foo \\\n a b", []string{"foo", "a", "b"}},
+	{"line continuation within a word", "fo\\\no", []string{"foo"}},
+	{"empty quoted word", "''", []string{""}},
+	{"dollar and backtick stay literal in single quotes", "'$foo `bar`'", []string{"$foo `bar`"}},
+}
+
+func TestSplit(t *testing.T) {
+	for _, c := range splitTests {
+		got, err := Split(c.in)
+		if err != nil {
+			t.Errorf("%s: Split(%q) returned error: %v", c.desc, c.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: Split(%q) = %#v, want %#v", c.desc, c.in, got, c.want)
+		}
+	}
+}
+
+var splitErrorTests = []struct {
+	desc string
+	in   string
+}{
+	{"unterminated single quote", `'foo`},
+	{"unterminated double quote", `"foo`},
+	{"trailing backslash", `foo\`},
+}
+
+func TestSplitErrors(t *testing.T) {
+	for _, c := range splitErrorTests {
+		if _, err := Split(c.in); err == nil {
+			t.Errorf("%s: Split(%q) did not return an error", c.desc, c.in)
+		}
+	}
+}
+
+var joinRoundTripTests = [][]string{
+	nil,
+	{},
+	{"foo"},
+	{"foo", "bar"},
+	{"foo bar"},
+	{"with'quote"},
+	{`with"quote`},
+	{"with'both\"quotes"},
+	{`with\backslash`},
+	{"with$dollar"},
+	{"with" + "`backtick`"},
+	{"*.go", "[a-z]*"},
+	{"line1\nline2"},
+	{""},
+	{"foo", "", "bar"},
+	{"tab\there"},
+}
+
+func TestSplitJoinRoundTrip(t *testing.T) {
+	for _, words := range joinRoundTripTests {
+		joined := Join(words)
+		got, err := Split(joined)
+		if err != nil {
+			t.Errorf("Split(Join(%#v)) returned error: %v", words, err)
+			continue
+		}
+		want := words
+		if len(want) == 0 {
+			want = nil
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Split(Join(%#v)) = %#v, want %#v (joined: %q)", words, got, want, joined)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2016, Daniel Martí <mvdan@mvdan.cc>
+// See LICENSE for licensing information
+
+package token
+
+import "fmt"
+
+// Pos is a compact encoding of a source position within a FileSet.
+// It can be converted into a Position for a human-readable form via
+// FileSet.Position. The zero value means "no position".
+type Pos int
+
+// NoPos is the zero value for Pos; it is never a valid position.
+const NoPos Pos = 0
+
+// Position describes a source position in a human-readable form.
+type Position struct {
+	Filename string
+	Offset   int // byte offset, starting at 0
+	Line     int // line number, starting at 1
+	Column   int // column number, starting at 1 (byte count)
+}
+
+func (p Position) IsValid() bool { return p.Line > 0 }
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	s := p.Filename
+	if s == "" {
+		s = "<input>"
+	}
+	return fmt.Sprintf("%s:%d:%d", s, p.Line, p.Column)
+}
+
+// File holds the position information for a single source file that
+// was added to a FileSet.
+type File struct {
+	name string
+	base int // offset of the first byte of this file within the FileSet
+	size int // size of the file in bytes, plus one for the end-of-file offset
+
+	lines []int // offsets of the beginnings of each line after the first
+}
+
+// Name returns the file name as registered with the FileSet.
+func (f *File) Name() string { return f.name }
+
+// AddLine records the offset of the start of a new line. Offsets must
+// be added in increasing order.
+func (f *File) AddLine(offset int) {
+	if n := len(f.lines); (n == 0 || f.lines[n-1] < offset) && offset < f.size {
+		f.lines = append(f.lines, offset)
+	}
+}
+
+// Pos returns the Pos value for the given byte offset within this
+// file.
+func (f *File) Pos(offset int) Pos {
+	return Pos(f.base + offset)
+}
+
+func (f *File) position(p Pos) Position {
+	offset := int(p) - f.base
+	line, col := 1, offset+1
+	for i, start := range f.lines {
+		if start > offset {
+			break
+		}
+		line = i + 2
+		col = offset - start + 1
+	}
+	return Position{
+		Filename: f.name,
+		Offset:   offset,
+		Line:     line,
+		Column:   col,
+	}
+}
+
+// FileSet tracks the source positions of an arbitrary number of
+// files, each occupying its own range of Pos values. It is modelled
+// after go/token.FileSet.
+type FileSet struct {
+	base  int
+	files []*File
+}
+
+// NewFileSet creates a new, empty FileSet.
+func NewFileSet() *FileSet {
+	return &FileSet{base: 1}
+}
+
+// AddFile adds a new file of the given name and size to the set and
+// returns a *File that can be used to obtain Pos values for offsets
+// within it.
+func (s *FileSet) AddFile(filename string, size int) *File {
+	f := &File{name: filename, base: s.base, size: size + 1}
+	s.base += f.size
+	s.files = append(s.files, f)
+	return f
+}
+
+// File returns the file that contains the given Pos, or nil if none
+// does.
+func (s *FileSet) File(p Pos) *File {
+	for _, f := range s.files {
+		if int(p) >= f.base && int(p) < f.base+f.size {
+			return f
+		}
+	}
+	return nil
+}
+
+// Position translates a Pos into a human-readable Position, using the
+// file it belongs to.
+func (s *FileSet) Position(p Pos) Position {
+	if f := s.File(p); f != nil {
+		return f.position(p)
+	}
+	return Position{}
+}